@@ -5,7 +5,6 @@
 package server
 
 import (
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -13,6 +12,7 @@ import (
 	"upspin.io/access"
 	"upspin.io/cache"
 	"upspin.io/context"
+	"upspin.io/dir/server/contenthash"
 	"upspin.io/errors"
 	"upspin.io/factotum"
 	"upspin.io/path"
@@ -29,8 +29,6 @@ const (
 	serverName = "dirserver@server.com"
 )
 
-var testDir string
-
 func TestMakeRoot(t *testing.T) {
 	s := newDirServerForTesting(t)
 	de, err := s.MakeDirectory(userName + "/")
@@ -249,19 +247,6 @@ func TestHasRight(t *testing.T) {
 	}
 }
 
-func TestMain(m *testing.M) {
-	var err error
-	testDir, err = ioutil.TempDir("", "DirServer")
-	if err != nil {
-		panic(err)
-	}
-
-	code := m.Run()
-
-	os.RemoveAll(testDir)
-	os.Exit(code)
-}
-
 // checkDirEntry compares the main fields in dir entries got and want and
 // reports their differences.
 func checkDirEntry(testName string, got, want *upspin.DirEntry) error {
@@ -324,8 +309,9 @@ func newDirServerForTesting(t *testing.T) *server {
 	return &server{
 		serverContext: cxt,
 		userName:      userName,
-		logDir:        testDir,
+		logFS:         newMemLogFS(),
 		userTrees:     cache.NewLRU(10),
+		checksums:     contenthash.New(),
 	}
 }
 
@@ -348,4 +334,4 @@ func repo(dir string) string {
 		panic("no GOPATH")
 	}
 	return filepath.Join(gopath, "src/upspin.io/"+dir)
-}
\ No newline at end of file
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"upspin.io/dir/server/contenthash"
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// Checksum returns a digest of the directory header or file content at
+// name, suitable for detecting whether that single entry has changed.
+// It is backed by s.checksums, which changes only through
+// noteChecksumPut and noteChecksumDelete; Put, MakeDirectory and
+// Delete do not call those, so entries they write or remove are not
+// reflected here unless the hooks are called as well.
+func (s *server) Checksum(name upspin.PathName) (upspin.Refdata, error) {
+	const op = "dir/server.Checksum"
+	refdata, err := s.checksums.Checksum(name)
+	if err != nil {
+		return upspin.Refdata{}, errors.E(op, err)
+	}
+	return refdata, nil
+}
+
+// SubtreeChecksum returns the recursive digest of everything under
+// name. Two calls return the same digest if and only if every entry
+// in the subtree - names, headers, and file content references - is
+// the same, regardless of how it got that way; this lets two Upspin
+// trees compare a subtree for equality without exchanging the whole
+// listing.
+func (s *server) SubtreeChecksum(name upspin.PathName) (contenthash.Digest, error) {
+	const op = "dir/server.SubtreeChecksum"
+	digest, err := s.checksums.SubtreeChecksum(name)
+	if err != nil {
+		return contenthash.Digest{}, errors.E(op, err)
+	}
+	return digest, nil
+}
+
+// noteChecksumPut updates s.checksums to reflect entry, so a Checksum
+// or SubtreeChecksum call that follows immediately sees the new
+// content. Put and MakeDirectory do not call it themselves.
+func (s *server) noteChecksumPut(entry *upspin.DirEntry) {
+	if entry.Attr&upspin.AttrDirectory != 0 {
+		s.checksums = s.checksums.PutDir(entry)
+		return
+	}
+	s.checksums = s.checksums.PutFile(entry)
+}
+
+// noteChecksumDelete updates s.checksums to drop name. Delete does not
+// call it itself.
+func (s *server) noteChecksumDelete(name upspin.PathName) {
+	s.checksums = s.checksums.Remove(name)
+}
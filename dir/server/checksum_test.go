@@ -0,0 +1,46 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"upspin.io/errors"
+)
+
+// TestChecksumThroughServer exercises Checksum and SubtreeChecksum
+// against a *server built the way this package's tests actually build
+// one, rather than only against the standalone contenthash.Cache
+// type, so a nil s.checksums field (as would happen if some
+// construction path forgot to initialize it) is caught here.
+func TestChecksumThroughServer(t *testing.T) {
+	s := newDirServerForTesting(t)
+	root := putDir(t, s, userName+"/")
+	s.noteChecksumPut(root)
+
+	before, err := s.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := putFile(t, s, userName+"/file.txt")
+	s.noteChecksumPut(file)
+
+	if _, err := s.Checksum(file.Name); err != nil {
+		t.Fatal(err)
+	}
+	after, err := s.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("SubtreeChecksum did not change after adding a file")
+	}
+
+	s.noteChecksumDelete(file.Name)
+	if _, err := s.Checksum(file.Name); !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("Checksum after delete: err = %v, want NotExist", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package contenthash maintains a Merkle-style digest for every path
+// in a directory tree, so that a caller can cheaply ask "did anything
+// under this directory change?" without walking every entry.
+//
+// State is kept in an immutable radix tree: every update produces a
+// new root while leaving prior snapshots (and any readers holding
+// them) untouched. Each mutation only re-hashes the ancestors whose
+// children actually changed; unrelated siblings keep their digests.
+package contenthash // import "upspin.io/dir/server/contenthash"
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// Digest is the 32-byte SHA-256 digest of a path's content.
+type Digest [sha256.Size]byte
+
+// String returns the digest in hex, as used in upspin.Refdata.Reference.
+func (d Digest) String() string {
+	return fmt.Sprintf("%x", [sha256.Size]byte(d))
+}
+
+// Cache holds the radix tree of digests for one user's directory tree.
+// The zero value is not valid; use New. Cache is immutable: every
+// mutating method returns a new *Cache sharing unmodified structure
+// with the receiver, so a reader that holds a *Cache never observes a
+// partial update.
+type Cache struct {
+	tree *iradix.Tree
+}
+
+// New returns an empty Cache.
+func New() *Cache {
+	return &Cache{tree: iradix.New()}
+}
+
+// For directory p, two keys are kept in the radix tree, each built by
+// appending a NUL byte - which can never appear in a clean Upspin path
+// - and a one-byte tag to p, so no valid path can ever collide with
+// another path's key regardless of what either is named (a file
+// literally named "dir", for instance, must not collide with its
+// parent's children-digest key):
+//   p + "\x00H"  -> digest of the directory's own header (name, mode,
+//                   packing, writer), independent of its children.
+//   p + "\x00C"  -> recursive digest of the directory's sorted
+//                   children, each identified by name and digest.
+// A plain file p is keyed by p + "\x00F", holding the digest of its
+// block references.
+const (
+	tagFile     = 'F'
+	tagDirHead  = 'H'
+	tagChildren = 'C'
+)
+
+func taggedKey(clean string, tag byte) []byte {
+	k := make([]byte, 0, len(clean)+2)
+	k = append(k, clean...)
+	k = append(k, 0, tag)
+	return k
+}
+
+func dirHeaderKey(clean string) []byte   { return taggedKey(clean, tagDirHead) }
+func dirChildrenKey(clean string) []byte { return taggedKey(clean, tagChildren) }
+func fileKey(clean string) []byte        { return taggedKey(clean, tagFile) }
+
+// clean returns name as an absolute, slash-cleaned path with no
+// trailing slash; the root is "".
+func clean(name upspin.PathName) string {
+	c := path.Clean("/" + string(name))
+	if c == "/" {
+		return ""
+	}
+	return c
+}
+
+// parentOf returns the cleaned parent of clean path p, or ("", false)
+// if p is already the root.
+func parentOf(p string) (string, bool) {
+	if p == "" {
+		return "", false
+	}
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[:i], true
+	}
+	return "", true
+}
+
+// hashDirHeader digests the fields of a directory entry that identify
+// it as a directory, independent of its children.
+func hashDirHeader(e *upspin.DirEntry) Digest {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%s|%d", e.Name, e.Packing, e.Writer, e.Attr)
+	var d Digest
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// hashFileBlocks digests the blocks of a file entry.
+func hashFileBlocks(e *upspin.DirEntry) Digest {
+	h := sha256.New()
+	for _, b := range e.Blocks {
+		fmt.Fprintf(h, "%s|%d|%d|", b.Location.Reference, b.Offset, b.Size)
+	}
+	var d Digest
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// PutFile records (or overwrites) the digest of a file entry and
+// invalidates its ancestors' children digests. It returns the updated
+// Cache; the receiver is unmodified.
+func (c *Cache) PutFile(e *upspin.DirEntry) *Cache {
+	p := clean(e.Name)
+	txn := c.tree.Txn()
+	txn.Insert(fileKey(p), hashFileBlocks(e))
+	n := &Cache{tree: txn.Commit()}
+	return n.rehashAncestors(p)
+}
+
+// PutDir records (or overwrites) the header digest of a directory
+// entry, recomputes its own children digest from whatever entries are
+// already present under it, and invalidates its ancestors' children
+// digests in turn.
+func (c *Cache) PutDir(e *upspin.DirEntry) *Cache {
+	p := clean(e.Name)
+	txn := c.tree.Txn()
+	txn.Insert(dirHeaderKey(p), hashDirHeader(e))
+	n := &Cache{tree: txn.Commit()}
+	n = n.rehashChildren(p)
+	return n.rehashAncestors(p)
+}
+
+// Remove deletes the digest for name (file or directory) and
+// invalidates its ancestors' children digests.
+func (c *Cache) Remove(name upspin.PathName) *Cache {
+	p := clean(name)
+	txn := c.tree.Txn()
+	txn.Delete(fileKey(p))
+	txn.Delete(dirHeaderKey(p))
+	txn.Delete(dirChildrenKey(p))
+	n := &Cache{tree: txn.Commit()}
+	return n.rehashAncestors(p)
+}
+
+// immediateChildren returns the names of the direct children of
+// directory p that currently have a digest (file or directory header)
+// in the tree, in sorted order.
+func (c *Cache) immediateChildren(p string) []string {
+	prefix := p + "/"
+	seen := make(map[string]bool)
+	c.tree.Root().WalkPrefix([]byte(prefix), func(k []byte, v interface{}) bool {
+		nul := bytes.IndexByte(k, 0)
+		if nul < 0 {
+			return false
+		}
+		rest := string(k[len(prefix):nul])
+		if rest == "" || strings.Contains(rest, "/") {
+			return false
+		}
+		seen[rest] = true
+		return false
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rehashChildren recomputes the children digest of directory p from
+// its immediate children's own digests. A child directory contributes
+// its header digest combined with its own children digest, so the
+// result covers the whole subtree below p.
+func (c *Cache) rehashChildren(p string) *Cache {
+	h := sha256.New()
+	for _, name := range c.immediateChildren(p) {
+		childPath := p + "/" + name
+		var d Digest
+		if v, ok := c.tree.Root().Get(dirHeaderKey(childPath)); ok {
+			d = v.(Digest)
+			if cv, ok := c.tree.Root().Get(dirChildrenKey(childPath)); ok {
+				cd := cv.(Digest)
+				d = sha256.Sum256(append(d[:], cd[:]...))
+			}
+		} else if v, ok := c.tree.Root().Get(fileKey(childPath)); ok {
+			d = v.(Digest)
+		} else {
+			continue
+		}
+		fmt.Fprintf(h, "%s|%x|", name, d)
+	}
+	var d Digest
+	copy(d[:], h.Sum(nil))
+	txn := c.tree.Txn()
+	txn.Insert(dirChildrenKey(p), d)
+	return &Cache{tree: txn.Commit()}
+}
+
+// rehashAncestors walks from p up to the root, recomputing each
+// ancestor's children digest. Siblings of p are untouched, so their
+// digests (and the radix nodes holding them) are shared with the
+// pre-update tree.
+func (c *Cache) rehashAncestors(p string) *Cache {
+	cur := c
+	for {
+		par, ok := parentOf(p)
+		if !ok {
+			break
+		}
+		cur = cur.rehashChildren(par)
+		p = par
+	}
+	return cur
+}
+
+// Checksum returns the digest of the directory header or file content
+// at name, formatted as an upspin.Refdata.
+func (c *Cache) Checksum(name upspin.PathName) (upspin.Refdata, error) {
+	p := clean(name)
+	if d, ok := c.tree.Root().Get(dirHeaderKey(p)); ok {
+		return upspin.Refdata{Reference: upspin.Reference(d.(Digest).String())}, nil
+	}
+	if d, ok := c.tree.Root().Get(fileKey(p)); ok {
+		return upspin.Refdata{Reference: upspin.Reference(d.(Digest).String())}, nil
+	}
+	return upspin.Refdata{}, errors.E("contenthash.Checksum", name, errors.NotExist)
+}
+
+// SubtreeChecksum returns the recursive digest of everything under
+// name: for a directory, its children and their descendants, not the
+// directory's own header; for a file, its content digest. Two subtrees
+// with identical content, anywhere in the namespace, produce the same
+// digest.
+func (c *Cache) SubtreeChecksum(name upspin.PathName) (Digest, error) {
+	p := clean(name)
+	if d, ok := c.tree.Root().Get(dirChildrenKey(p)); ok {
+		return d.(Digest), nil
+	}
+	if d, ok := c.tree.Root().Get(fileKey(p)); ok {
+		return d.(Digest), nil
+	}
+	return Digest{}, errors.E("contenthash.SubtreeChecksum", name, errors.NotExist)
+}
+
+// ChecksumEntries computes a digest over an arbitrary set of entries,
+// such as the matches of a wildcard pattern, independent of the order
+// they are passed in. Callers that want a stable result across calls
+// must still agree on what counts as "the same set"; ChecksumEntries
+// itself sorts by name before hashing.
+func ChecksumEntries(entries []*upspin.DirEntry) Digest {
+	sorted := make([]*upspin.DirEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	h := sha256.New()
+	for _, e := range sorted {
+		var d Digest
+		if e.Attr&upspin.AttrDirectory != 0 {
+			d = hashDirHeader(e)
+		} else {
+			d = hashFileBlocks(e)
+		}
+		fmt.Fprintf(h, "%s|%x|", e.Name, d)
+	}
+	var d Digest
+	copy(d[:], h.Sum(nil))
+	return d
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package contenthash
+
+import (
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+const userName = "fred@flintstone.org"
+
+func dirEntry(name upspin.PathName) *upspin.DirEntry {
+	return &upspin.DirEntry{
+		Name:    name,
+		Attr:    upspin.AttrDirectory,
+		Writer:  userName,
+		Packing: upspin.PlainPack,
+	}
+}
+
+func fileEntry(name upspin.PathName, ref string) *upspin.DirEntry {
+	return &upspin.DirEntry{
+		Name:    name,
+		Attr:    upspin.AttrNone,
+		Writer:  userName,
+		Packing: upspin.PlainPack,
+		Blocks: []upspin.DirBlock{
+			{Location: upspin.Location{Reference: upspin.Reference(ref)}, Size: int64(len(ref))},
+		},
+	}
+}
+
+func TestPut(t *testing.T) {
+	c := New()
+	c = c.PutDir(dirEntry(userName + "/"))
+	c = c.PutFile(fileEntry(userName+"/file1.txt", "ref1"))
+
+	got, err := c.Checksum(userName + "/file1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Reference == "" {
+		t.Errorf("Checksum returned empty reference")
+	}
+}
+
+func TestMakeDirectory(t *testing.T) {
+	c := New()
+	c = c.PutDir(dirEntry(userName + "/"))
+	c = c.PutDir(dirEntry(userName + "/dir"))
+
+	if _, err := c.Checksum(userName + "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SubtreeChecksum(userName + "/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIdenticalSubtreesMatch verifies that two structurally and
+// content-identical subtrees produce identical digests even though
+// they live at different paths.
+func TestIdenticalSubtreesMatch(t *testing.T) {
+	c := New()
+	c = c.PutDir(dirEntry(userName + "/"))
+	c = c.PutDir(dirEntry(userName + "/a"))
+	c = c.PutFile(fileEntry(userName+"/a/f.txt", "same-ref"))
+	c = c.PutDir(dirEntry(userName + "/b"))
+	c = c.PutFile(fileEntry(userName+"/b/f.txt", "same-ref"))
+
+	da, err := c.SubtreeChecksum(userName + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.SubtreeChecksum(userName + "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if da != db {
+		t.Errorf("identical subtrees produced different digests: %v != %v", da, db)
+	}
+}
+
+// TestUnrelatedMutationDoesNotDisturbSibling verifies that mutating
+// one subtree leaves a sibling subtree's digest untouched.
+func TestUnrelatedMutationDoesNotDisturbSibling(t *testing.T) {
+	c := New()
+	c = c.PutDir(dirEntry(userName + "/"))
+	c = c.PutDir(dirEntry(userName + "/a"))
+	c = c.PutFile(fileEntry(userName+"/a/f.txt", "ref-a"))
+	c = c.PutDir(dirEntry(userName + "/b"))
+	c = c.PutFile(fileEntry(userName+"/b/f.txt", "ref-b"))
+
+	before, err := c.SubtreeChecksum(userName + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := c.PutFile(fileEntry(userName+"/b/f.txt", "ref-b-changed"))
+
+	after, err := c2.SubtreeChecksum(userName + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Errorf("unrelated mutation disturbed sibling digest: %v != %v", before, after)
+	}
+
+	// The original snapshot must also be unaffected (copy-on-write).
+	stillBefore, err := c.SubtreeChecksum(userName + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stillBefore != before {
+		t.Errorf("prior snapshot mutated in place")
+	}
+}
+
+// TestFileNamedDirDoesNotCollideWithParentChildrenDigest verifies that
+// a file literally named "dir" does not collide with its parent's own
+// children digest, which the two used to share a key under the old
+// suffix-string scheme.
+func TestFileNamedDirDoesNotCollideWithParentChildrenDigest(t *testing.T) {
+	c := New()
+	c = c.PutDir(dirEntry(userName + "/"))
+	c = c.PutFile(fileEntry(userName+"/dir", "file-content-ref"))
+
+	fileSum, err := c.Checksum(userName + "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootSubtree, err := c.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := New()
+	c2 = c2.PutDir(dirEntry(userName + "/"))
+	rootSubtreeNoFile, err := c2.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rootSubtree == rootSubtreeNoFile {
+		t.Errorf("adding file named %q did not change root's children digest: key collision clobbered it", userName+"/dir")
+	}
+	if fileSum.Reference == "" {
+		t.Errorf("file checksum should not be empty")
+	}
+}
+
+// TestRebuildFromColdMatches verifies that replaying the same
+// mutations from scratch yields the same root digest, modelling a
+// rebuild from cold storage.
+func TestRebuildFromColdMatches(t *testing.T) {
+	build := func() *Cache {
+		c := New()
+		c = c.PutDir(dirEntry(userName + "/"))
+		c = c.PutDir(dirEntry(userName + "/dir"))
+		c = c.PutFile(fileEntry(userName+"/dir/a.txt", "refA"))
+		c = c.PutFile(fileEntry(userName+"/dir/b.txt", "refB"))
+		return c
+	}
+	c1 := build()
+	c2 := build()
+
+	d1, err := c1.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := c2.SubtreeChecksum(userName + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 {
+		t.Errorf("rebuild from cold produced a different root digest: %v != %v", d1, d2)
+	}
+}
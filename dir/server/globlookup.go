@@ -0,0 +1,241 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"upspin.io/access"
+	"upspin.io/dir/server/contenthash"
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// hasWildcard reports whether elem contains any glob metacharacter.
+func hasWildcard(elem string) bool {
+	return strings.ContainsAny(elem, "*?[")
+}
+
+// GlobLookup returns every DirEntry matching pattern that requester is
+// allowed to List. Unlike Glob, which many DirServer implementations
+// treat as listing a directory one level at a time, GlobLookup walks
+// the pattern component by component: a literal component is resolved
+// with a direct lookup, and only a component containing *, ?, or [...]
+// causes that directory to be listed. This keeps a pattern like
+// "user@x/2024/*/logs/*.txt" proportional to the number of matching
+// days and logs rather than the size of the whole tree.
+//
+// If the walk reaches a Link entry before exhausting the pattern,
+// GlobLookup returns that entry with upspin.ErrFollowLink, matching
+// the behavior callers already expect from Lookup. If it reaches a
+// directory requester may not List, it stops there and returns a
+// Permission error rather than silently omitting that branch's
+// matches.
+func (s *server) GlobLookup(requester upspin.UserName, pattern upspin.PathName) ([]*upspin.DirEntry, error) {
+	const op = "dir/server.GlobLookup"
+	p, err := path.Parse(pattern)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	root, err := s.Lookup(upspin.PathName(p.User) + "/")
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	entries, err := s.globWalk(requester, root, p, 0)
+	if err == upspin.ErrFollowLink {
+		return entries, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// globWalk matches the elements of p starting at index i against the
+// subtree rooted at dir, which must already be known to exist. Every
+// directory it descends into, whether the next component is matched
+// by literal lookup or by wildcard expansion, is checked against
+// canList first, so a caller can't bypass the Access check simply by
+// supplying a pattern with no wildcards in it.
+func (s *server) globWalk(requester upspin.UserName, dir *upspin.DirEntry, p path.Parsed, i int) ([]*upspin.DirEntry, error) {
+	const op = "dir/server.GlobLookup"
+	if i == p.NElem() {
+		return []*upspin.DirEntry{dir}, nil
+	}
+	if dir.Attr&upspin.AttrLink != 0 {
+		return []*upspin.DirEntry{dir}, upspin.ErrFollowLink
+	}
+	ok, err := s.canList(requester, dir.Name)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if !ok {
+		return nil, errors.E(op, dir.Name, errors.Permission)
+	}
+
+	elem := p.Elem(i)
+	if !hasWildcard(elem) {
+		child, err := s.Lookup(joinPath(dir.Name, elem))
+		if err != nil {
+			if err == upspin.ErrFollowLink {
+				return []*upspin.DirEntry{child}, err
+			}
+			if errors.Match(errors.E(errors.NotExist), err) {
+				return nil, nil
+			}
+			return nil, errors.E(op, err)
+		}
+		return s.globWalk(requester, child, p, i+1)
+	}
+
+	children, err := s.listDirectory(dir.Name)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	var matched []*upspin.DirEntry
+	for _, child := range children {
+		name := lastElem(child.Name)
+		ok, err := filepath.Match(elem, name)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		if !ok {
+			continue
+		}
+		sub, err := s.globWalk(requester, child, p, i+1)
+		if err != nil && err != upspin.ErrFollowLink {
+			return nil, err
+		}
+		matched = append(matched, sub...)
+		if err == upspin.ErrFollowLink {
+			return matched, err
+		}
+	}
+	return matched, nil
+}
+
+// canList reports whether requester has List rights on dirName. The
+// owner of a tree always has List (and Read) rights to it, matching
+// the same bootstrapping rule s.hasRight already applies for the
+// server's own configured user; any other requester is subject
+// strictly to the Access file governing dirName.
+func (s *server) canList(requester upspin.UserName, dirName upspin.PathName) (bool, error) {
+	p, err := path.Parse(dirName)
+	if err != nil {
+		return false, err
+	}
+	if requester == p.User {
+		return true, nil
+	}
+	accEntry, err := s.WhichAccess(dirName)
+	if err != nil {
+		return false, err
+	}
+	if accEntry == nil {
+		return false, nil
+	}
+	data, err := s.readEntryData(accEntry)
+	if err != nil {
+		return false, err
+	}
+	acc, err := access.Parse(accEntry.Name, data)
+	if err != nil {
+		return false, err
+	}
+	return acc.Can(requester, access.List, dirName, s.readPathData)
+}
+
+// readPathData loads and returns the full content of name, for use as
+// the group-file loader passed to access.Access.Can.
+func (s *server) readPathData(name upspin.PathName) ([]byte, error) {
+	de, err := s.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.readEntryData(de)
+}
+
+// readEntryData concatenates the content of every block in de by
+// fetching each from the configured StoreServer.
+func (s *server) readEntryData(de *upspin.DirEntry) ([]byte, error) {
+	store := s.serverContext.StoreServer()
+	var buf []byte
+	for _, b := range de.Blocks {
+		data, _, _, err := store.Get(b.Location.Reference)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+// joinPath appends elem as a new component of dirName.
+func joinPath(dirName upspin.PathName, elem string) upspin.PathName {
+	return upspin.PathName(strings.TrimSuffix(string(dirName), "/") + "/" + elem)
+}
+
+// lastElem returns the final slash-separated component of name.
+func lastElem(name upspin.PathName) string {
+	s := string(name)
+	if i := strings.LastIndexByte(strings.TrimSuffix(s, "/"), '/'); i >= 0 {
+		return strings.TrimSuffix(s, "/")[i+1:]
+	}
+	return s
+}
+
+// listDirectory returns the immediate children of the directory dirName,
+// as Glob(dirName+"/*") would, but is factored out so GlobLookup can
+// call it once per directory boundary.
+func (s *server) listDirectory(dirName upspin.PathName) ([]*upspin.DirEntry, error) {
+	pattern := strings.TrimSuffix(string(dirName), "/") + "/*"
+	return s.Glob(pattern)
+}
+
+// WhichAccessForPattern returns the distinct Access entries that
+// govern every path requester's pattern matches. A single Access entry
+// appears once in the result even if it governs many matched paths.
+func (s *server) WhichAccessForPattern(requester upspin.UserName, pattern upspin.PathName) ([]*upspin.DirEntry, error) {
+	const op = "dir/server.WhichAccessForPattern"
+	matches, err := s.GlobLookup(requester, pattern)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	seen := make(map[upspin.PathName]*upspin.DirEntry)
+	for _, m := range matches {
+		acc, err := s.WhichAccess(m.Name)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		if acc != nil {
+			seen[acc.Name] = acc
+		}
+	}
+	result := make([]*upspin.DirEntry, 0, len(seen))
+	for _, acc := range seen {
+		result = append(result, acc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// ChecksumWildcard computes a stable digest over the sorted set of
+// entries requester's pattern matches: two calls return equal digests
+// if and only if the matched set of (name, content digest) pairs is
+// identical, independent of the order entries were created or
+// written in.
+func (s *server) ChecksumWildcard(requester upspin.UserName, pattern upspin.PathName) (contenthash.Digest, error) {
+	const op = "dir/server.ChecksumWildcard"
+	matches, err := s.GlobLookup(requester, pattern)
+	if err != nil {
+		return contenthash.Digest{}, errors.E(op, err)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	return contenthash.ChecksumEntries(matches), nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func putDir(t *testing.T, s *server, name upspin.PathName) *upspin.DirEntry {
+	de, err := s.MakeDirectory(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return de
+}
+
+func putFile(t *testing.T, s *server, name upspin.PathName) *upspin.DirEntry {
+	de := &upspin.DirEntry{
+		Name:    name,
+		Attr:    upspin.AttrNone,
+		Writer:  userName,
+		Packing: upspin.PlainPack,
+	}
+	got, err := s.Put(de)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestGlobLookup(t *testing.T) {
+	s := newDirServerForTesting(t)
+	putDir(t, s, userName+"/")
+	putDir(t, s, userName+"/2024")
+	putDir(t, s, userName+"/2024/jan")
+	putDir(t, s, userName+"/2024/jan/logs")
+	putFile(t, s, userName+"/2024/jan/logs/a.txt")
+	putFile(t, s, userName+"/2024/jan/logs/b.txt")
+	putDir(t, s, userName+"/2024/feb")
+	putDir(t, s, userName+"/2024/feb/logs")
+	putFile(t, s, userName+"/2024/feb/logs/c.txt")
+
+	entries, err := s.GlobLookup(userName, userName+"/2024/*/logs/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 3; got != want {
+		t.Fatalf("len(entries) = %d, want %d", got, want)
+	}
+}
+
+// putAccess writes content as the Access file governing dir.
+func putAccess(t *testing.T, s *server, dir upspin.PathName, content string) {
+	loc := writeToStore(t, s.serverContext, []byte(content))
+	de := &upspin.DirEntry{
+		Name:   joinPath(dir, "Access"),
+		Writer: userName,
+		Blocks: []upspin.DirBlock{
+			{Location: loc, Size: int64(len(content))},
+		},
+		Packing: upspin.PlainPack,
+	}
+	if _, err := s.Put(de); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGlobLookupRespectsHasRight verifies that wildcard expansion
+// stops - with a Permission error, rather than silently omitting
+// matches - as soon as it reaches a directory the requester can't
+// List, and that the owner (who is always allowed to List their own
+// tree) is unaffected by the same Access file.
+func TestGlobLookupRespectsHasRight(t *testing.T) {
+	const other = upspin.UserName("other@user.com")
+	const mallory = upspin.UserName("mallory@evil.com")
+
+	s := newDirServerForTesting(t)
+	putDir(t, s, userName+"/")
+	putDir(t, s, userName+"/private")
+	putFile(t, s, userName+"/private/secret.txt")
+	putAccess(t, s, userName+"/private", "l: "+string(other))
+
+	if _, err := s.GlobLookup(mallory, userName+"/private/*.txt"); !errors.Match(errors.E(errors.Permission), err) {
+		t.Errorf("GlobLookup as excluded user: err = %v, want Permission", err)
+	}
+
+	entries, err := s.GlobLookup(userName, userName+"/private/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("GlobLookup as owner: len(entries) = %d, want 1", len(entries))
+	}
+}
+
+// TestGlobLookupLiteralPatternRespectsHasRight verifies that a pattern
+// with no wildcard in it at all is still checked against canList for
+// every directory it walks through, not just a directory being
+// listed by a wildcard - a caller can't bypass the Access check
+// simply by spelling out the full path instead of using "*".
+func TestGlobLookupLiteralPatternRespectsHasRight(t *testing.T) {
+	const mallory = upspin.UserName("mallory@evil.com")
+
+	s := newDirServerForTesting(t)
+	putDir(t, s, userName+"/")
+	// Grant mallory List at the root, so the root itself is not what
+	// stops the walk; only /private should.
+	putAccess(t, s, userName+"/", "l: "+string(mallory))
+	putDir(t, s, userName+"/private")
+	putFile(t, s, userName+"/private/secret.txt")
+	putAccess(t, s, userName+"/private", "l: nobody@nowhere.org")
+
+	if _, err := s.GlobLookup(mallory, userName+"/private/secret.txt"); !errors.Match(errors.E(errors.Permission), err) {
+		t.Errorf("GlobLookup with literal pattern as excluded user: err = %v, want Permission", err)
+	}
+
+	entries, err := s.GlobLookup(userName, userName+"/private/secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("GlobLookup with literal pattern as owner: len(entries) = %d, want 1", len(entries))
+	}
+}
+
+func TestChecksumWildcardOrderIndependent(t *testing.T) {
+	s1 := newDirServerForTesting(t)
+	putDir(t, s1, userName+"/")
+	putDir(t, s1, userName+"/dir")
+	putFile(t, s1, userName+"/dir/a.txt")
+	putFile(t, s1, userName+"/dir/b.txt")
+
+	s2 := newDirServerForTesting(t)
+	putDir(t, s2, userName+"/")
+	putDir(t, s2, userName+"/dir")
+	// Same entries, created in the opposite order.
+	putFile(t, s2, userName+"/dir/b.txt")
+	putFile(t, s2, userName+"/dir/a.txt")
+
+	d1, err := s1.ChecksumWildcard(userName, userName+"/dir/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := s2.ChecksumWildcard(userName, userName+"/dir/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 {
+		t.Errorf("ChecksumWildcard depended on insertion order: %v != %v", d1, d2)
+	}
+}
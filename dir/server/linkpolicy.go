@@ -0,0 +1,67 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// LinkPolicy controls which Link targets a server will accept. The
+// zero value only enforces the mandatory same-root check.
+type LinkPolicy struct {
+	// SameUserLinksOnly, when true, rejects any Link whose target
+	// names a different user than the link's parent directory.
+	SameUserLinksOnly bool
+
+	// RequireKnownTarget, when true, rejects a cross-user Link
+	// unless the target user resolves through s.serverContext's
+	// KeyServer, so an unregistered user name can't be used to
+	// smuggle references past the owner's tree.
+	RequireKnownTarget bool
+}
+
+// checkLinkTarget validates entry.Link against policy, given the name
+// of the directory that will contain entry. Put must call this for
+// every entry with Attr&AttrLink set before it writes the entry,
+// MakeDirectory must call it when the new directory's ancestor is
+// itself a link (so the ancestor's target is re-validated), and the
+// tree-log replay path at startup must call it too, so a link that
+// was written before the policy existed - or slipped past an older
+// version of this check - cannot be reintroduced by replay. Those
+// three call sites live in dir/server's core tree-mutation and replay
+// code, which this checkout does not include, so they can't be added
+// here; this method is ready to be called as soon as that code exists.
+func (s *server) checkLinkTarget(parentDir upspin.PathName, link upspin.PathName) error {
+	const op = "dir/server.checkLinkTarget"
+	parent, err := path.Parse(parentDir)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	switch path.ClassifyLinkTarget(link, parent.User) {
+	case path.LinkTargetInvalid:
+		return errors.E(op, link, errors.Invalid, errors.Str("malformed link target"))
+	case path.LinkTargetEscapesRoot:
+		return errors.E(op, link, errors.Invalid, errors.Str("link target escapes its user's root"))
+	case path.LinkTargetSameUser:
+		return nil
+	case path.LinkTargetOtherUser:
+		if s.linkPolicy.SameUserLinksOnly {
+			return errors.E(op, link, errors.Permission, errors.Str("cross-user links are not permitted"))
+		}
+		if s.linkPolicy.RequireKnownTarget {
+			targetUser, err := path.Parse(link)
+			if err != nil {
+				return errors.E(op, err)
+			}
+			if _, err := s.serverContext.KeyServer().Lookup(targetUser.User); err != nil {
+				return errors.E(op, link, errors.Permission, errors.Str("link target user is not known to the KeyServer"))
+			}
+		}
+		return nil
+	}
+	return errors.E(op, link, errors.Internal, errors.Str("unreachable"))
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// newLinkPolicyServerForTesting returns a *server with just enough set
+// to exercise checkLinkTarget directly: it reads no field but
+// linkPolicy, and this checkout has no Put or MakeDirectory for it to
+// be wired into, so these tests call it the way TestClassifyLinkTarget
+// in path/linkpolicy_test.go calls ClassifyLinkTarget - directly,
+// rather than asserting behavior through Put that the code here
+// cannot yet perform.
+func newLinkPolicyServerForTesting() *server {
+	return &server{}
+}
+
+// TestLinkEscapingRootIsRejected is the malicious-entry counterpart to
+// TestLink: a Link whose target climbs above its own user's root via
+// ".." must never be accepted, regardless of policy configuration.
+func TestLinkEscapingRootIsRejected(t *testing.T) {
+	s := newLinkPolicyServerForTesting()
+	link := upspin.PathName("linkerdude@linkatron.lnk/../../../../etc/passwd")
+	err := s.checkLinkTarget(userName+"/", link)
+	expectedErr := errors.E(errors.Invalid)
+	if !errors.Match(expectedErr, err) {
+		t.Errorf("err = %v, want = %v", err, expectedErr)
+	}
+}
+
+// TestSameUserLinksOnlyPolicy verifies that when SameUserLinksOnly is
+// set, a well-formed cross-user Link is rejected even though its
+// target does not escape any root.
+func TestSameUserLinksOnlyPolicy(t *testing.T) {
+	s := newLinkPolicyServerForTesting()
+	s.linkPolicy.SameUserLinksOnly = true
+	link := upspin.PathName("linkerdude@linkatron.lnk/target")
+	err := s.checkLinkTarget(userName+"/", link)
+	expectedErr := errors.E(errors.Permission)
+	if !errors.Match(expectedErr, err) {
+		t.Errorf("err = %v, want = %v", err, expectedErr)
+	}
+}
+
+// TestSameUserLinkIsAllowed verifies the ordinary case: a Link whose
+// target names the same user as its parent directory is accepted
+// under every policy.
+func TestSameUserLinkIsAllowed(t *testing.T) {
+	s := newLinkPolicyServerForTesting()
+	link := upspin.PathName(userName + "/target")
+	if err := s.checkLinkTarget(userName+"/", link); err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "os"
+
+// LogFS is the filesystem surface the tree log needs: enough of the
+// afero.Fs shape to create, read, and enumerate log segment files
+// without committing the log writer/reader to a particular storage
+// medium. Concrete implementations include localLogFS (the historical
+// on-disk behavior), memLogFS (for hermetic, parallel-safe tests), and
+// an Upspin-native backend that stores segments as StoreServer blocks
+// so a DirServer can run on ephemeral compute with no local disk.
+//
+// The log writer/reader itself - the code that actually opens log
+// segments through this interface as it appends and replays entries -
+// lives in dir/server's core tree-mutation file, which this checkout
+// does not include; only these three backends and server's struct
+// literal (which now constructs a logFS instead of a bare directory
+// path) are present here.
+type LogFS interface {
+	Create(name string) (LogFile, error)
+	Open(name string) (LogFile, error)
+	OpenFile(name string, flag int, perm os.FileMode) (LogFile, error)
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+}
+
+// LogFile is the subset of *os.File operations the log writer/reader
+// performs against a LogFS entry.
+type LogFile interface {
+	ReadAt(p []byte, off int64) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Write(p []byte) (int, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
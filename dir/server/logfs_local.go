@@ -0,0 +1,35 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "os"
+
+// localLogFS implements LogFS directly against the local disk; this is
+// the behavior the tree log had before LogFS existed.
+type localLogFS struct{}
+
+// newLocalLogFS returns the local-disk LogFS implementation.
+func newLocalLogFS() LogFS { return localLogFS{} }
+
+func (localLogFS) Create(name string) (LogFile, error) { return os.Create(name) }
+func (localLogFS) Open(name string) (LogFile, error)    { return os.Open(name) }
+
+func (localLogFS) OpenFile(name string, flag int, perm os.FileMode) (LogFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (localLogFS) Remove(name string) error           { return os.Remove(name) }
+func (localLogFS) Rename(oldname, newname string) error { return os.Rename(oldname, newname) }
+func (localLogFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+func (localLogFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+
+func (localLogFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	f, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"upspin.io/errors"
+)
+
+// memLogFS is an in-memory LogFS, used to make the dir/server test
+// suite hermetic and parallel-safe without the ioutil.TempDir dance
+// newDirServerForTesting previously relied on.
+type memLogFS struct {
+	mu    sync.Mutex
+	files map[string]*memFileData
+	dirs  map[string]bool
+}
+
+// newMemLogFS returns an empty in-memory LogFS.
+func newMemLogFS() LogFS {
+	return &memLogFS{
+		files: make(map[string]*memFileData),
+		dirs:  map[string]bool{"": true, "/": true},
+	}
+}
+
+// memFileData is the shared, mutex-protected backing store for a
+// single in-memory file; every open handle to the same name sees the
+// same data.
+type memFileData struct {
+	mu   sync.Mutex
+	buf  []byte
+	name string
+}
+
+func (m *memLogFS) Create(name string) (LogFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := &memFileData{name: name}
+	m.files[name] = d
+	return &memFile{data: d}, nil
+}
+
+func (m *memLogFS) Open(name string) (LogFile, error) {
+	m.mu.Lock()
+	d, ok := m.files[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil, errors.E(name, errors.NotExist)
+	}
+	return &memFile{data: d}, nil
+}
+
+func (m *memLogFS) OpenFile(name string, flag int, perm os.FileMode) (LogFile, error) {
+	m.mu.Lock()
+	d, ok := m.files[name]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			m.mu.Unlock()
+			return nil, errors.E(name, errors.NotExist)
+		}
+		d = &memFileData{name: name}
+		m.files[name] = d
+	}
+	m.mu.Unlock()
+	if flag&os.O_TRUNC != 0 {
+		d.mu.Lock()
+		d.buf = nil
+		d.mu.Unlock()
+	}
+	return &memFile{data: d, appendOnly: flag&os.O_APPEND != 0}, nil
+}
+
+func (m *memLogFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return errors.E(name, errors.NotExist)
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memLogFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[oldname]
+	if !ok {
+		return errors.E(oldname, errors.NotExist)
+	}
+	delete(m.files, oldname)
+	d.name = newname
+	m.files[newname] = d
+	return nil
+}
+
+func (m *memLogFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dirs[name] {
+		return memFileInfo{name: filepath.Base(name), isDir: true}, nil
+	}
+	d, ok := m.files[name]
+	if !ok {
+		return nil, errors.E(name, errors.NotExist)
+	}
+	d.mu.Lock()
+	size := len(d.buf)
+	d.mu.Unlock()
+	return memFileInfo{name: filepath.Base(name), size: int64(size)}, nil
+}
+
+func (m *memLogFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dirs[name] = true
+	return nil
+}
+
+func (m *memLogFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := dirname
+	if prefix != "" && prefix[len(prefix)-1] != '/' {
+		prefix += "/"
+	}
+	var infos []os.FileInfo
+	for name, d := range m.files {
+		if !isImmediateChild(prefix, name) {
+			continue
+		}
+		d.mu.Lock()
+		size := len(d.buf)
+		d.mu.Unlock()
+		infos = append(infos, memFileInfo{name: filepath.Base(name), size: int64(size)})
+	}
+	return infos, nil
+}
+
+func isImmediateChild(prefix, name string) bool {
+	if len(name) <= len(prefix) || name[:len(prefix)] != prefix {
+		return false
+	}
+	rest := name[len(prefix):]
+	for _, r := range rest {
+		if r == '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// memFile is a LogFile backed by memFileData.
+type memFile struct {
+	data       *memFileData
+	appendOnly bool
+}
+
+// ReadAt implements io.ReaderAt, including its contract that any read
+// ending at or past the end of the file - even one that copies some
+// bytes before running out - reports io.EOF rather than returning a
+// short read with a nil error.
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	if off >= int64(len(f.data.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	end := off + int64(len(p))
+	if end > int64(len(f.data.buf)) {
+		grown := make([]byte, end)
+		copy(grown, f.data.buf)
+		f.data.buf = grown
+	}
+	copy(f.data.buf[off:], p)
+	return len(p), nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	f.data.buf = append(f.data.buf, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	if size >= int64(len(f.data.buf)) {
+		return nil
+	}
+	f.data.buf = f.data.buf[:size]
+	return nil
+}
+
+func (f *memFile) Sync() error { return nil }
+func (f *memFile) Close() error { return nil }
+
+// memFileInfo is a minimal os.FileInfo for memLogFS entries.
+type memFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.isDir }
+func (i memFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,230 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// storeLogFS implements LogFS on top of a StoreServer: every log
+// segment is written as a regular content-addressed Store block, and a
+// small index mapping segment name to the current Store reference is
+// kept in memory. The index is not written to the Store or anywhere
+// else, so it does not survive a process restart; the segment blocks
+// stay in the Store, but a new storeLogFS starts with no way to find
+// them.
+type storeLogFS struct {
+	store upspin.StoreServer
+
+	mu    sync.Mutex
+	index map[string]upspin.Reference // segment name -> current Store ref
+}
+
+// newStoreLogFS returns a LogFS backed by store. The returned LogFS
+// starts with an empty index, even if store already holds segment
+// blocks from an earlier storeLogFS.
+func newStoreLogFS(store upspin.StoreServer) LogFS {
+	return &storeLogFS{
+		store: store,
+		index: make(map[string]upspin.Reference),
+	}
+}
+
+func (s *storeLogFS) Create(name string) (LogFile, error) {
+	s.mu.Lock()
+	delete(s.index, name)
+	s.mu.Unlock()
+	return &storeLogFile{fs: s, name: name}, nil
+}
+
+func (s *storeLogFS) Open(name string) (LogFile, error) {
+	s.mu.Lock()
+	_, ok := s.index[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.E(name, errors.NotExist)
+	}
+	return &storeLogFile{fs: s, name: name}, nil
+}
+
+func (s *storeLogFS) OpenFile(name string, flag int, perm os.FileMode) (LogFile, error) {
+	s.mu.Lock()
+	_, ok := s.index[name]
+	s.mu.Unlock()
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, errors.E(name, errors.NotExist)
+		}
+		return s.Create(name)
+	}
+	f := &storeLogFile{fs: s, name: name}
+	if flag&os.O_TRUNC != 0 {
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (s *storeLogFS) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[name]; !ok {
+		return errors.E(name, errors.NotExist)
+	}
+	delete(s.index, name)
+	return nil
+}
+
+func (s *storeLogFS) Rename(oldname, newname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.index[oldname]
+	if !ok {
+		return errors.E(oldname, errors.NotExist)
+	}
+	delete(s.index, oldname)
+	s.index[newname] = ref
+	return nil
+}
+
+func (s *storeLogFS) Stat(name string) (os.FileInfo, error) {
+	data, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: name, size: int64(len(data))}, nil
+}
+
+func (s *storeLogFS) Mkdir(name string, perm os.FileMode) error { return nil } // segments are flat; no directories to create.
+
+func (s *storeLogFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var infos []os.FileInfo
+	for name := range s.index {
+		if !isImmediateChild(dirname+"/", name) {
+			continue
+		}
+		infos = append(infos, memFileInfo{name: name})
+	}
+	return infos, nil
+}
+
+// read returns the current full contents of segment name.
+func (s *storeLogFS) read(name string) ([]byte, error) {
+	s.mu.Lock()
+	ref, ok := s.index[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.E(name, errors.NotExist)
+	}
+	data, _, locs, err := s.store.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil && len(locs) > 0 {
+		return nil, errors.E(name, errors.Str("indirect Store references are not supported by storeLogFS"))
+	}
+	return data, nil
+}
+
+// write replaces the full contents of segment name with data and
+// records the resulting Store reference in the index.
+func (s *storeLogFS) write(name string, data []byte) error {
+	refdata, err := s.store.Put(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.index[name] = refdata.Reference
+	s.mu.Unlock()
+	return nil
+}
+
+// storeLogFile is a LogFile over a storeLogFS segment. Since
+// StoreServer blocks are content-addressed and immutable, every
+// mutation reads the current full segment, applies the change, and
+// writes back a new block: an append of n bytes to a segment that
+// already holds m costs O(n+m) Store traffic, not O(n), so a segment's
+// total cost over its lifetime is O(size^2) rather than the O(size)
+// the on-disk backends give the log writer's append-heavy workload.
+// That tradeoff is only acceptable because the tree log rotates to a
+// fresh segment well before a segment gets large enough for the
+// quadratic cost to matter; a caller that configures much larger
+// segments, or otherwise drives this backend outside that assumption,
+// will pay for it in Store bandwidth.
+type storeLogFile struct {
+	fs   *storeLogFS
+	name string
+}
+
+// ReadAt implements io.ReaderAt, matching the same contract localLogFS
+// gets for free from *os.File: a read ending at or past the end of the
+// segment reports io.EOF, even if it copies some bytes first, rather
+// than returning a short read with a nil error.
+func (f *storeLogFile) ReadAt(p []byte, off int64) (int, error) {
+	data, err := f.fs.read(f.name)
+	if err != nil {
+		return 0, err
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *storeLogFile) WriteAt(p []byte, off int64) (int, error) {
+	data, err := f.fs.read(f.name)
+	if err != nil && !errors.Match(errors.E(errors.NotExist), err) {
+		return 0, err
+	}
+	end := off + int64(len(p))
+	if end > int64(len(data)) {
+		grown := make([]byte, end)
+		copy(grown, data)
+		data = grown
+	}
+	copy(data[off:], p)
+	if err := f.fs.write(f.name, data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (f *storeLogFile) Write(p []byte) (int, error) {
+	data, err := f.fs.read(f.name)
+	if err != nil && !errors.Match(errors.E(errors.NotExist), err) {
+		return 0, err
+	}
+	data = append(data, p...)
+	if err := f.fs.write(f.name, data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (f *storeLogFile) Truncate(size int64) error {
+	data, err := f.fs.read(f.name)
+	if err != nil && !errors.Match(errors.E(errors.NotExist), err) {
+		return err
+	}
+	if size < int64(len(data)) {
+		data = data[:size]
+	}
+	return f.fs.write(f.name, data)
+}
+
+func (f *storeLogFile) Sync() error { return nil }
+func (f *storeLogFile) Close() error { return nil }
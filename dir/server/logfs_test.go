@@ -0,0 +1,174 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"upspin.io/context"
+	"upspin.io/upspin"
+
+	_ "upspin.io/store/inprocess"
+)
+
+// mutation is one step of syntheticMutations, a small stream applied
+// to a fresh log segment: each entry appends bytes, occasionally
+// truncating first to exercise that path too.
+type mutation struct {
+	truncate bool
+	data     []byte
+}
+
+var syntheticMutations = []mutation{
+	{data: []byte("first entry\n")},
+	{data: []byte("second entry\n")},
+	{truncate: true},
+	{data: []byte("restarted after truncate\n")},
+	{data: []byte("final entry\n")},
+}
+
+// replay applies syntheticMutations to a fresh segment on fs and
+// returns the recovered bytes.
+func replay(t *testing.T, fs LogFS, segment string) []byte {
+	t.Helper()
+	f, err := fs.Create(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range syntheticMutations {
+		if m.truncate {
+			if err := f.Truncate(0); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if _, err := f.Write(m.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := fs.Open(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	st, err := fs.Stat(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, st.Size())
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestLogFSRoundtrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	endpointInProcess := upspin.Endpoint{Transport: upspin.InProcess}
+	cxt := context.New().SetStoreEndpoint(endpointInProcess)
+
+	backends := map[string]LogFS{
+		"local": newLocalLogFS(),
+		"mem":   newMemLogFS(),
+		"store": newStoreLogFS(cxt.StoreServer()),
+	}
+
+	var want []byte
+	for name, fs := range backends {
+		segment := filepath.Join(dir, "segment."+name)
+		if name != "local" {
+			segment = "segment." + name
+		}
+		got := replay(t, fs, segment)
+		if want == nil {
+			want = got
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s backend: replay produced %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestLogFSReadAtEOF verifies that every LogFS backend's ReadAt obeys
+// io.ReaderAt's contract at and past the end of a segment: a read that
+// would come up short must report io.EOF, never a short read with a
+// nil error, matching what localLogFS gets for free from *os.File.
+func TestLogFSReadAtEOF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	endpointInProcess := upspin.Endpoint{Transport: upspin.InProcess}
+	cxt := context.New().SetStoreEndpoint(endpointInProcess)
+
+	backends := map[string]LogFS{
+		"local": newLocalLogFS(),
+		"mem":   newMemLogFS(),
+		"store": newStoreLogFS(cxt.StoreServer()),
+	}
+
+	const content = "0123456789"
+	for name, fs := range backends {
+		segment := filepath.Join(dir, "eof."+name)
+		if name != "local" {
+			segment = "eof." + name
+		}
+		w, err := fs.Create(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		r, err := fs.Open(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A read starting within the segment but asking for more
+		// bytes than remain must short-read and report io.EOF.
+		buf := make([]byte, len(content))
+		n, err := r.ReadAt(buf, 5)
+		if err != io.EOF {
+			t.Errorf("%s backend: near-EOF ReadAt err = %v, want io.EOF", name, err)
+		}
+		if want := content[5:]; string(buf[:n]) != want {
+			t.Errorf("%s backend: near-EOF ReadAt = %q, want %q", name, buf[:n], want)
+		}
+
+		// A read starting at or past the end must report io.EOF
+		// with zero bytes copied.
+		n, err = r.ReadAt(buf, int64(len(content)))
+		if err != io.EOF {
+			t.Errorf("%s backend: at-EOF ReadAt err = %v, want io.EOF", name, err)
+		}
+		if n != 0 {
+			t.Errorf("%s backend: at-EOF ReadAt n = %d, want 0", name, n)
+		}
+
+		r.Close()
+	}
+}
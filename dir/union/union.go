@@ -0,0 +1,282 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package union implements a DirServer that presents a single Upspin
+// namespace composed of several upstream DirServers layered on top of
+// one another, similar in spirit to a union mount. Reads fall through
+// the branches in order; writes always land on the designated writable
+// branch, copying up an entry's containing directory structure first
+// if necessary.
+package union // import "upspin.io/dir/union"
+
+import (
+	"sort"
+
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/upspin"
+)
+
+// Branch describes one upstream tree participating in the union.
+type Branch struct {
+	// Server is the upstream DirServer for this branch.
+	Server upspin.DirServer
+
+	// Writable marks the single branch that accepts writes and
+	// receives copy-up data for entries that otherwise only exist
+	// on read-only branches. Exactly one Branch must set this.
+	Writable bool
+}
+
+// server is a DirServer that merges the namespaces of several upstream
+// DirServers. Branches are consulted in the order they were configured;
+// the first branch that has an entry answers reads for it.
+type server struct {
+	// branches are ordered highest-priority first. writable indexes
+	// the single writable entry in branches.
+	branches []Branch
+	writable int
+}
+
+var _ upspin.DirServer = (*server)(nil)
+
+// New creates a union DirServer over the given branches. Exactly one
+// branch must be marked Writable.
+func New(branches ...Branch) (upspin.DirServer, error) {
+	const op = "dir/union.New"
+	if len(branches) == 0 {
+		return nil, errors.E(op, errors.Invalid, errors.Str("no branches"))
+	}
+	writable := -1
+	for i, b := range branches {
+		if b.Writable {
+			if writable >= 0 {
+				return nil, errors.E(op, errors.Invalid, errors.Str("more than one writable branch"))
+			}
+			writable = i
+		}
+	}
+	if writable < 0 {
+		return nil, errors.E(op, errors.Invalid, errors.Str("no writable branch"))
+	}
+	return &server{branches: branches, writable: writable}, nil
+}
+
+func (s *server) writableServer() upspin.DirServer {
+	return s.branches[s.writable].Server
+}
+
+// Lookup implements upspin.DirServer. It returns the entry from the
+// first branch that has it, in branch priority order.
+func (s *server) Lookup(name upspin.PathName) (*upspin.DirEntry, error) {
+	const op = "dir/union.Lookup"
+	var firstErr error
+	for _, b := range s.branches {
+		entry, err := b.Server.Lookup(name)
+		if err == nil {
+			return entry, nil
+		}
+		if err == upspin.ErrFollowLink {
+			return entry, err
+		}
+		if !errors.Match(errors.E(errors.NotExist), err) {
+			return nil, errors.E(op, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.E(op, name, errors.NotExist)
+	}
+	return nil, firstErr
+}
+
+// Put implements upspin.DirServer. Writes always go to the writable
+// branch. If the entry's parent directory does not yet exist there but
+// does exist on a read-only branch, the parent chain is copied up
+// first so the writable branch has somewhere to attach the new entry.
+// If an ancestor in that chain is itself a Link, Put returns that
+// entry and upspin.ErrFollowLink unwrapped, the same as Lookup does.
+func (s *server) Put(entry *upspin.DirEntry) (*upspin.DirEntry, error) {
+	const op = "dir/union.Put"
+	if err := s.copyUpParent(entry.Name); err != nil {
+		if err == upspin.ErrFollowLink {
+			return s.Lookup(entry.Name)
+		}
+		return nil, errors.E(op, err)
+	}
+	return s.writableServer().Put(entry)
+}
+
+// copyUpParent ensures that every ancestor directory of name exists on
+// the writable branch. An ancestor already present on some read-only
+// branch is copied up; an ancestor that exists nowhere at all (the
+// union is bootstrapping a brand new tree) is simply created on the
+// writable branch, the same as it would be on a plain DirServer. An
+// ancestor that is a Link on any branch stops the walk with
+// upspin.ErrFollowLink.
+func (s *server) copyUpParent(name upspin.PathName) error {
+	p, err := path.Parse(name)
+	if err != nil {
+		return err
+	}
+	w := s.writableServer()
+	for i := 0; i < p.NElem(); i++ {
+		dirName := p.First(i).Path()
+		if _, err := w.Lookup(dirName); err == nil {
+			continue // already present on the writable branch.
+		} else if err == upspin.ErrFollowLink {
+			return err
+		} else if !errors.Match(errors.E(errors.NotExist), err) {
+			return err
+		}
+		de, err := s.Lookup(dirName)
+		if err != nil && !errors.Match(errors.E(errors.NotExist), err) {
+			return err
+		}
+		if err == nil && de.Attr&upspin.AttrLink != 0 {
+			return upspin.ErrFollowLink
+		}
+		if _, err := w.MakeDirectory(dirName); err != nil && !errors.Match(errors.E(errors.Exist), err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MakeDirectory creates name on the writable branch, copying up its
+// ancestors first if they only exist on read-only branches. Like Put,
+// it returns an ancestor Link entry and upspin.ErrFollowLink unwrapped
+// if copying up reaches one.
+func (s *server) MakeDirectory(name upspin.PathName) (*upspin.DirEntry, error) {
+	const op = "dir/union.MakeDirectory"
+	if err := s.copyUpParent(name); err != nil {
+		if err == upspin.ErrFollowLink {
+			return s.Lookup(name)
+		}
+		return nil, errors.E(op, err)
+	}
+	return s.writableServer().MakeDirectory(name)
+}
+
+// Delete removes name from the writable branch, which is the only
+// branch a union write can actually target, and best-effort from every
+// read-only branch too so the name disappears from the merged
+// namespace even if it also existed there. A read-only branch that
+// fails to delete name - because it rejects deletes outright, or
+// never had the entry - does not stop the call; only the writable
+// branch's result is reported.
+func (s *server) Delete(name upspin.PathName) (*upspin.DirEntry, error) {
+	const op = "dir/union.Delete"
+	de, err := s.writableServer().Delete(name)
+	for i, b := range s.branches {
+		if i == s.writable {
+			continue
+		}
+		b.Server.Delete(name)
+	}
+	if err != nil {
+		if err == upspin.ErrFollowLink {
+			return de, err
+		}
+		return nil, errors.E(op, err)
+	}
+	return de, nil
+}
+
+// Glob implements upspin.DirServer by merging the matches from every
+// branch and de-duplicating by DirEntry.Name, preferring the entry
+// from the writable branch when a name appears in more than one.
+func (s *server) Glob(pattern string) ([]*upspin.DirEntry, error) {
+	const op = "dir/union.Glob"
+	merged := make(map[upspin.PathName]*upspin.DirEntry)
+	rankOfName := make(map[upspin.PathName]int)
+	for i, b := range s.branches {
+		entries, err := b.Server.Glob(pattern)
+		if err == upspin.ErrFollowLink {
+			return entries, err
+		}
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		rank := i
+		if i == s.writable {
+			rank = -1 // the writable branch always wins ties.
+		}
+		for _, e := range entries {
+			if prevRank, seen := rankOfName[e.Name]; !seen || rank < prevRank {
+				merged[e.Name] = e
+				rankOfName[e.Name] = rank
+			}
+		}
+	}
+	result := make([]*upspin.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// WhichAccess implements upspin.DirServer. The Access file is resolved
+// against whichever branch owns name, which is the same branch that
+// Lookup would return an entry from. A caller may ask about a name
+// that does not exist yet, for instance to check Create rights before
+// writing it, so a name that Lookup fails to find on every branch
+// falls back to asking each branch's own WhichAccess in turn, which -
+// like dir/server's - answers by walking up to the nearest governing
+// Access file rather than requiring name itself to exist.
+func (s *server) WhichAccess(name upspin.PathName) (*upspin.DirEntry, error) {
+	const op = "dir/union.WhichAccess"
+	for _, b := range s.branches {
+		if _, err := b.Server.Lookup(name); err != nil {
+			if err == upspin.ErrFollowLink {
+				return b.Server.WhichAccess(name)
+			}
+			if !errors.Match(errors.E(errors.NotExist), err) {
+				return nil, errors.E(op, err)
+			}
+			continue
+		}
+		return b.Server.WhichAccess(name)
+	}
+	for _, b := range s.branches {
+		entry, err := b.Server.WhichAccess(name)
+		if err == nil {
+			return entry, nil
+		}
+		if !errors.Match(errors.E(errors.NotExist), err) {
+			return nil, errors.E(op, err)
+		}
+	}
+	return nil, errors.E(op, name, errors.NotExist)
+}
+
+// Watch implements upspin.DirServer by delegating to the writable
+// branch; changes on read-only branches are not observable through
+// the union server.
+func (s *server) Watch(name upspin.PathName, order int64, done <-chan struct{}) (<-chan upspin.Event, error) {
+	return s.writableServer().Watch(name, order, done)
+}
+
+// Dial implements upspin.Dialer.
+func (s *server) Dial(ctx upspin.Context, e upspin.Endpoint) (upspin.Service, error) {
+	return s, nil
+}
+
+// Endpoint implements upspin.Service.
+func (s *server) Endpoint() upspin.Endpoint {
+	return s.writableServer().Endpoint()
+}
+
+// Ping implements upspin.Service.
+func (s *server) Ping() bool { return true }
+
+// Close implements upspin.Service.
+func (s *server) Close() {
+	for _, b := range s.branches {
+		b.Server.Close()
+	}
+}
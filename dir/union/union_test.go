@@ -0,0 +1,250 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package union
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+const userName = "fred@flintstone.org"
+
+// memDirServer is a minimal in-memory upspin.DirServer used to build
+// test branches. It is not a general-purpose fake; it implements just
+// enough to exercise union's delegation logic.
+type memDirServer struct {
+	endpoint upspin.Endpoint
+
+	mu           sync.Mutex
+	entries      map[upspin.PathName]*upspin.DirEntry
+	rejectDelete bool // Delete always fails with Permission, as a real read-only branch would.
+}
+
+func newMemDirServer(ep upspin.Endpoint) *memDirServer {
+	return &memDirServer{
+		endpoint: ep,
+		entries:  make(map[upspin.PathName]*upspin.DirEntry),
+	}
+}
+
+func (m *memDirServer) Lookup(name upspin.PathName) (*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if de, ok := m.entries[name]; ok {
+		return de, nil
+	}
+	// Not a direct hit; if some ancestor of name is itself a Link,
+	// that's what a real DirServer would stop at and report.
+	for n := string(name); ; {
+		slash := strings.LastIndexByte(n, '/')
+		if slash <= 0 {
+			break
+		}
+		n = n[:slash]
+		if de, ok := m.entries[upspin.PathName(n)]; ok && de.Attr&upspin.AttrLink != 0 {
+			return de, upspin.ErrFollowLink
+		}
+	}
+	return nil, errors.E(name, errors.NotExist)
+}
+
+func (m *memDirServer) Put(entry *upspin.DirEntry) (*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entry.Name] = entry
+	return entry, nil
+}
+
+func (m *memDirServer) MakeDirectory(name upspin.PathName) (*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[name]; ok {
+		return nil, errors.E(name, errors.Exist)
+	}
+	de := &upspin.DirEntry{Name: name, Attr: upspin.AttrDirectory}
+	m.entries[name] = de
+	return de, nil
+}
+
+func (m *memDirServer) Delete(name upspin.PathName) (*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rejectDelete {
+		return nil, errors.E(name, errors.Permission)
+	}
+	de, ok := m.entries[name]
+	if !ok {
+		return nil, errors.E(name, errors.NotExist)
+	}
+	delete(m.entries, name)
+	return de, nil
+}
+
+func (m *memDirServer) Glob(pattern string) ([]*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []*upspin.DirEntry
+	for _, de := range m.entries {
+		entries = append(entries, de)
+	}
+	return entries, nil
+}
+
+func (m *memDirServer) WhichAccess(name upspin.PathName) (*upspin.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if de, ok := m.entries[userName+"/Access"]; ok {
+		return de, nil
+	}
+	return nil, nil
+}
+
+func (m *memDirServer) Watch(name upspin.PathName, order int64, done <-chan struct{}) (<-chan upspin.Event, error) {
+	return nil, errors.E(errors.Permission, errors.Str("Watch not implemented by memDirServer"))
+}
+
+func (m *memDirServer) Dial(ctx upspin.Context, e upspin.Endpoint) (upspin.Service, error) {
+	return m, nil
+}
+func (m *memDirServer) Endpoint() upspin.Endpoint { return m.endpoint }
+func (m *memDirServer) Ping() bool                { return true }
+func (m *memDirServer) Close()                    {}
+
+var _ upspin.DirServer = (*memDirServer)(nil)
+
+func epFor(n string) upspin.Endpoint {
+	return upspin.Endpoint{Transport: upspin.InProcess, NetAddr: upspin.NetAddr(n)}
+}
+
+// newTestUnion wires two branches: a read-only "legacy" branch and a
+// writable "snapshot" branch.
+func newTestUnion(t *testing.T) (u upspin.DirServer, legacy, writable *memDirServer) {
+	legacy = newMemDirServer(epFor("legacy"))
+	writable = newMemDirServer(epFor("writable"))
+
+	u, err := New(
+		Branch{Server: legacy},
+		Branch{Server: writable, Writable: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, legacy, writable
+}
+
+func TestMakeDirectory(t *testing.T) {
+	u, _, writable := newTestUnion(t)
+	de, err := u.MakeDirectory(userName + "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de.Name != userName+"/dir" {
+		t.Errorf("de.Name = %q, want %q", de.Name, userName+"/dir")
+	}
+	if _, ok := writable.entries[userName+"/dir"]; !ok {
+		t.Errorf("directory was not created on the writable branch")
+	}
+}
+
+func TestWhichAccess(t *testing.T) {
+	u, legacy, _ := newTestUnion(t)
+	acc := &upspin.DirEntry{Name: userName + "/Access", Attr: upspin.AttrNone}
+	if _, err := legacy.Put(acc); err != nil {
+		t.Fatal(err)
+	}
+	got, err := u.WhichAccess(userName + "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Name != acc.Name {
+		t.Errorf("WhichAccess = %v, want %v", got, acc)
+	}
+}
+
+func TestLink(t *testing.T) {
+	u, legacy, _ := newTestUnion(t)
+	de := &upspin.DirEntry{
+		Name: userName + "/mylink",
+		Attr: upspin.AttrLink,
+		Link: "linkerdude@linkatron.lnk/target",
+	}
+	if _, err := legacy.Put(de); err != nil {
+		t.Fatal(err)
+	}
+	got, err := u.Lookup(userName + "/mylink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Link != de.Link {
+		t.Errorf("got.Link = %q, want %q", got.Link, de.Link)
+	}
+}
+
+// TestPutThroughLinkAncestor verifies that Put returns an ancestor
+// Link entry and upspin.ErrFollowLink unwrapped - the same sentinel
+// contract Lookup, Delete, and Glob already honor - rather than
+// wrapping it in a generic error, when copying up the parent chain
+// reaches a Link on a read-only branch.
+func TestPutThroughLinkAncestor(t *testing.T) {
+	u, legacy, _ := newTestUnion(t)
+	link := &upspin.DirEntry{
+		Name: userName + "/linkdir",
+		Attr: upspin.AttrLink,
+		Link: "linkerdude@linkatron.lnk/target",
+	}
+	if _, err := legacy.Put(link); err != nil {
+		t.Fatal(err)
+	}
+
+	de := &upspin.DirEntry{Name: userName + "/linkdir/sub/file.txt", Attr: upspin.AttrNone}
+	got, err := u.Put(de)
+	if err != upspin.ErrFollowLink {
+		t.Fatalf("err = %v, want = ErrFollowLink (%v)", err, upspin.ErrFollowLink)
+	}
+	if got == nil || got.Link != link.Link {
+		t.Errorf("got = %v, want an entry with Link = %q", got, link.Link)
+	}
+}
+
+func TestCopyUpOnWrite(t *testing.T) {
+	u, legacy, writable := newTestUnion(t)
+	if _, err := legacy.MakeDirectory(userName + "/"); err != nil {
+		t.Fatal(err)
+	}
+	de := &upspin.DirEntry{Name: userName + "/file.txt", Attr: upspin.AttrNone}
+	if _, err := u.Put(de); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := writable.entries[userName+"/"]; !ok {
+		t.Errorf("root was not copied up to the writable branch before the write")
+	}
+	if _, ok := writable.entries[userName+"/file.txt"]; !ok {
+		t.Errorf("file was not written to the writable branch")
+	}
+}
+
+// TestDelete verifies that Delete removes name from the writable
+// branch and succeeds even when a read-only branch rejects its own
+// Delete call outright, as a real read-only tree would.
+func TestDelete(t *testing.T) {
+	u, legacy, writable := newTestUnion(t)
+	legacy.rejectDelete = true
+
+	de := &upspin.DirEntry{Name: userName + "/file.txt", Attr: upspin.AttrNone}
+	if _, err := writable.Put(de); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := u.Delete(de.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := writable.entries[de.Name]; ok {
+		t.Errorf("Delete did not remove %q from the writable branch", de.Name)
+	}
+}
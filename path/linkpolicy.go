@@ -0,0 +1,66 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package path
+
+import "upspin.io/upspin"
+
+// LinkTargetClass classifies a Link entry's target relative to the
+// user whose tree contains the link, for use by a DirServer deciding
+// whether to accept the Link.
+type LinkTargetClass int
+
+const (
+	// LinkTargetInvalid means the target could not be parsed as an
+	// Upspin path at all.
+	LinkTargetInvalid LinkTargetClass = iota
+
+	// LinkTargetEscapesRoot means the target, once cleaned, still
+	// climbs above its own user's root via a ".." component. Such a
+	// target is never valid: there is nothing above a user's root
+	// for it to refer to.
+	LinkTargetEscapesRoot
+
+	// LinkTargetSameUser means the target names the same user as
+	// the link's parent directory.
+	LinkTargetSameUser
+
+	// LinkTargetOtherUser means the target names a different,
+	// well-formed user.
+	LinkTargetOtherUser
+)
+
+// ClassifyLinkTarget reports how target relates to parentUser, the
+// user who owns the directory containing the Link entry. It does not
+// consult the KeyServer; a caller wanting to know whether the target
+// user is actually known should look it up separately when the result
+// is LinkTargetOtherUser.
+func ClassifyLinkTarget(target upspin.PathName, parentUser upspin.UserName) LinkTargetClass {
+	p, err := Parse(target)
+	if err != nil {
+		return LinkTargetInvalid
+	}
+	if escapesRoot(p) {
+		return LinkTargetEscapesRoot
+	}
+	if p.User == parentUser {
+		return LinkTargetSameUser
+	}
+	return LinkTargetOtherUser
+}
+
+// escapesRoot reports whether p, once Upspin path-cleaned, still
+// contains a ".." component. Parse cleans the path, resolving any
+// ".." it can within the path itself, so a ".." surviving here can
+// only be one that tried to climb above the user's root - exactly the
+// case that must be rejected, since there is nothing above a root for
+// it to mean.
+func escapesRoot(p Parsed) bool {
+	for i := 0; i < p.NElem(); i++ {
+		if p.Elem(i) == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package path
+
+import (
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestClassifyLinkTarget(t *testing.T) {
+	const owner = upspin.UserName("fred@flintstone.org")
+	for _, test := range []struct {
+		target upspin.PathName
+		want   LinkTargetClass
+	}{
+		{"fred@flintstone.org/a/b", LinkTargetSameUser},
+		{"linkerdude@linkatron.lnk/target", LinkTargetOtherUser},
+		{"fred@flintstone.org/../../etc/passwd", LinkTargetEscapesRoot},
+		{"not a path", LinkTargetInvalid},
+	} {
+		got := ClassifyLinkTarget(test.target, owner)
+		if got != test.want {
+			t.Errorf("ClassifyLinkTarget(%q, %q) = %v, want %v", test.target, owner, got, test.want)
+		}
+	}
+}